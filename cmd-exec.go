@@ -0,0 +1,372 @@
+/*
+ * Copyright (C) 2017 "IoT.bzh"
+ * Author Sebastien Douheret <sebastien@iot.bzh>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/iotbzh/xds-agent/lib/xaapiv1"
+	"github.com/urfave/cli"
+)
+
+// exec sub-command flags, shared with the legacy top-level invocation
+var (
+	prjID         string
+	rPath         string
+	sdkid         string
+	withTimestamp bool
+	listProject   bool
+	noSyncWait    bool
+	syncTimeout   int
+)
+
+var execFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:        "id",
+		EnvVar:      "XDS_PROJECT_ID",
+		Usage:       "project ID you want to build (mandatory variable)",
+		Destination: &prjID,
+	},
+	cli.BoolFlag{
+		Name:        "list, ls",
+		Usage:       "list existing projects",
+		Destination: &listProject,
+	},
+	cli.StringFlag{
+		Name:        "rpath",
+		EnvVar:      "XDS_RPATH",
+		Usage:       "relative path into project",
+		Destination: &rPath,
+	},
+	cli.StringFlag{
+		Name:        "sdkid",
+		EnvVar:      "XDS_SDK_ID",
+		Usage:       "Cross Sdk ID to use to build project",
+		Destination: &sdkid,
+	},
+	cli.BoolFlag{
+		Name:        "timestamp, ts",
+		EnvVar:      "XDS_TIMESTAMP",
+		Usage:       "prefix output with timestamp",
+		Destination: &withTimestamp,
+	},
+	cli.BoolFlag{
+		Name:        "interactive",
+		EnvVar:      "XDS_INTERACTIVE",
+		Usage:       "keep stdin open and forward it to the remote process (eg. for GDB)",
+		Destination: &interactiveMode,
+	},
+	cli.StringFlag{
+		Name:        "gdb-server-port",
+		EnvVar:      "XDS_GDBSERVER_PORT",
+		Usage:       "TCP port used by gdbserver on the remote side",
+		Destination: &gdbServerPort,
+	},
+	cli.BoolFlag{
+		Name:        "no-sync-wait",
+		EnvVar:      "XDS_NO_SYNC_WAIT",
+		Usage:       "don't wait for project file-sync before executing (CI scenarios that manage sync externally)",
+		Destination: &noSyncWait,
+	},
+	cli.IntFlag{
+		Name:        "sync-timeout",
+		EnvVar:      "XDS_SYNC_TIMEOUT",
+		Usage:       "max time (in seconds) to wait for project file-sync",
+		Value:       120,
+		Destination: &syncTimeout,
+	},
+}
+
+// newExecCommand creates the 'exec' sub-command, IOW the original/default
+// xds-exec behavior: `xds-exec --id xxx -- <cmd>`
+func newExecCommand() cli.Command {
+	return cli.Command{
+		Name:      "exec",
+		Usage:     "execute a command on a XDS project (default command)",
+		ArgsUsage: "-- <command> [args...]",
+		Flags:     execFlags,
+		Action:    execAction,
+	}
+}
+
+// signalArgs is the body posted to the agent '/signal' route to forward
+// a host signal to the remote running command
+type signalArgs struct {
+	ID     string `json:"id"`
+	CmdID  string `json:"cmdID"`
+	Signal string `json:"signal"`
+}
+
+// exitResult holds the result of the remote command once it has exited,
+// either naturally (ExecExitEvent) or because a forwarded signal tore it down.
+type exitResult struct {
+	error error
+	code  int
+}
+
+// execInprogressMsg is sent by the agent right after a '/exec' request has
+// been accepted, giving us the remote command ID needed to later address
+// a '/signal' request to the right process.
+type execInprogressMsg struct {
+	CmdID string `json:"cmdID"`
+}
+
+// forwardSignals installs a signal.Notify handler and forwards SIGINT,
+// SIGTERM, SIGHUP and SIGQUIT to the remote exec'ed command so that it gets
+// cleanly terminated instead of being left running on the agent/server side.
+// cmdID is read under mu since it is only known once the exec-inprogress
+// event (or a later one) has been received. Whatever happens remotely (the
+// id isn't known yet, the POST fails, ...), xds-exec itself always exits
+// locally on these signals, using the usual 128+signal exit code, matching
+// the behavior of native exec/make.
+func forwardSignals(prjID string, cmdID *string, mu *sync.Mutex, exitChan chan<- exitResult) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+
+	go func() {
+		for sig := range sigChan {
+			s := sig.(syscall.Signal)
+
+			mu.Lock()
+			id := *cmdID
+			mu.Unlock()
+
+			if id == "" {
+				log.Warnf("Received signal %v but no remote command ID known yet, exiting locally", sig)
+				exitChan <- exitResult{nil, 128 + int(s)}
+				continue
+			}
+
+			log.Infof("Forwarding signal %v to remote command %s", sig, id)
+			body, err := json.Marshal(signalArgs{ID: prjID, CmdID: id, Signal: s.String()})
+			if err != nil {
+				log.Errorf("Cannot marshal signal args: %v", err)
+			} else if err := HTTPCli.HTTPPost("/signal", string(body)); err != nil {
+				log.Errorf("Error while posting signal %v to agent: %v", sig, err)
+			}
+
+			// Remote teardown requested (best-effort) above, exit the way
+			// users expect from native exec/make on Ctrl+C / kill.
+			exitChan <- exitResult{nil, 128 + int(s)}
+		}
+	}()
+}
+
+// execAction implements the 'exec' command (and the legacy top-level action):
+// it sends argsCommand to be run remotely on the project prjID and streams
+// back its output until it exits.
+func execAction(ctx *cli.Context) error {
+	var err error
+
+	execCommand := "/exec"
+	ccHelp := "'mkdir build; cd build; cmake ..'"
+
+	log.Infof("Execute: %s %v", execCommand, argsCommand)
+
+	// Retrieve projects list used by help output
+	var data []byte
+	if err := HTTPCli.HTTPGet("/projects", &data); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	log.Debugf("Result of /projects: %v", string(data[:]))
+
+	projects := []xaapiv1.ProjectConfig{}
+	errMar := json.Unmarshal(data, &projects)
+
+	// Check mandatory args
+	if prjID == "" || listProject {
+		msg := ""
+		exc := 0
+		if !listProject {
+			msg = "XDS_PROJECT_ID environment variable must be set !\n"
+			exc = 1
+		}
+		if errMar == nil {
+			msg += "List of existing projects (use: export XDS_PROJECT_ID=<< ID >>): \n"
+			msg += "  ID\t\t\t\t | Label"
+			for _, f := range projects {
+				msg += fmt.Sprintf("\n  %s\t | %s", f.ID, f.Label)
+				if f.DefaultSdk != "" {
+					msg += fmt.Sprintf("\t(default SDK: %s)", f.DefaultSdk)
+				}
+			}
+			msg += "\n"
+		}
+
+		data = nil
+		if err := HTTPCli.HTTPGet("/servers/0/sdks", &data); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		log.Debugf("Result of /sdks: %v", string(data[:]))
+
+		sdks := []xaapiv1.SDK{}
+		errMar = json.Unmarshal(data, &sdks)
+		if errMar == nil {
+			msg += "\nList of installed cross SDKs (use: export XDS_SDK_ID=<< ID >>): \n"
+			msg += "  ID\t\t\t\t\t | NAME\n"
+			for _, s := range sdks {
+				msg += fmt.Sprintf("  %s\t | %s\n", s.ID, s.Name)
+			}
+		}
+
+		if len(projects) > 0 && len(sdks) > 0 {
+			msg += fmt.Sprintf("\n")
+			msg += fmt.Sprintf("For example: \n")
+			msg += fmt.Sprintf("  %s --id %q --sdkid %q -- %s\n", AppName, projects[0].ID, sdks[0].ID, ccHelp)
+			msg += " or\n"
+			msg += fmt.Sprintf("  XDS_PROJECT_ID=%q XDS_SDK_ID=%q  %s %s\n", projects[0].ID, sdks[0].ID, AppNativeName, ccHelp)
+		}
+
+		return cli.NewExitError(msg, exc)
+	}
+
+	// Wait for the project file-sync to complete before executing (see
+	// waitProjectSync), unless opted-out.
+	if !noSyncWait {
+		if err := waitProjectSync(prjID, time.Duration(syncTimeout)*time.Second); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+
+	// Process Socket IO events
+	exitChan := make(chan exitResult, 1)
+
+	// Remote command ID, known once the exec-inprogress event is received ;
+	// guards against sending a signal before the agent started the command.
+	var cmdID string
+	var cmdIDMutex sync.Mutex
+
+	IOSkClient.On("disconnection", func(err error) {
+		exitChan <- exitResult{err, 2}
+	})
+
+	IOSkClient.On("exec-inprogress", func(ev execInprogressMsg) {
+		cmdIDMutex.Lock()
+		cmdID = ev.CmdID
+		cmdIDMutex.Unlock()
+		log.Debugf("Remote command ID: %s", cmdID)
+	})
+
+	outFunc := func(timestamp, stdout, stderr string) {
+		tm := ""
+		if withTimestamp && !isGdbOutput(stdout) {
+			tm = timestamp + "| "
+		}
+		if stdout != "" {
+			fmt.Printf("%s%s", tm, stdout)
+		}
+		if stderr != "" {
+			fmt.Fprintf(os.Stderr, "%s%s", tm, stderr)
+		}
+	}
+
+	IOSkClient.On(xaapiv1.ExecOutEvent, func(ev xaapiv1.ExecOutMsg) {
+		outFunc(ev.Timestamp, ev.Stdout, ev.Stderr)
+	})
+
+	IOSkClient.On(xaapiv1.ExecExitEvent, func(ev xaapiv1.ExecExitMsg) {
+		exitChan <- exitResult{ev.Error, ev.Code}
+	})
+
+	// Retrieve the projects definition
+	var project *xaapiv1.ProjectConfig
+	for _, f := range projects {
+		if f.ID == prjID {
+			project = &f
+			break
+		}
+	}
+
+	// Auto setup rPath if needed
+	if rPath == "" && project != nil {
+		cwd, err := os.Getwd()
+		if err == nil {
+			fldRp := project.ClientPath
+			if !strings.HasPrefix(fldRp, "/") {
+				fldRp = "/" + fldRp
+			}
+			log.Debugf("Try to auto-setup rPath: cwd=%s ; ClientPath=%s", cwd, fldRp)
+			if sp := strings.SplitAfter(cwd, fldRp); len(sp) == 2 {
+				rPath = strings.Trim(sp[1], "/")
+				log.Debugf("Auto-setup rPath to: '%s'", rPath)
+			}
+		}
+	}
+
+	// Build env
+	log.Debugf("Command env: %v", envMap)
+	env := []string{}
+	for k, v := range envMap {
+		env = append(env, k+"="+v)
+	}
+	if gdbServerPort != "" {
+		env = append(env, "XDS_GDBSERVER_PORT="+gdbServerPort)
+	}
+
+	// Send build command
+	var body []byte
+	args := xaapiv1.ExecArgs{
+		ID:         prjID,
+		SdkID:      sdkid,
+		Cmd:        strings.Trim(argsCommand[0], " "),
+		Args:       argsCommand[1:],
+		Env:        env,
+		RPath:      rPath,
+		CmdTimeout: 60,
+	}
+	body, err = json.Marshal(args)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	log.Infof("POST %s%s %v", baseURL, execCommand, string(body))
+	if err := HTTPCli.HTTPPost(execCommand, string(body)); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	// Forward host signals (Ctrl+C, ...) to the remote command so it
+	// doesn't keep running on the agent/server side once we exit.
+	forwardSignals(prjID, &cmdID, &cmdIDMutex, exitChan)
+
+	// In GDB-wrapper/interactive mode, forward stdin to the remote process
+	// and put the local terminal in raw mode so prompts behave interactively.
+	if isInteractiveMode() {
+		restoreTerm := setupInteractiveMode(&cmdID, &cmdIDMutex)
+		defer restoreTerm()
+	}
+
+	// Wait exit
+	select {
+	case res := <-exitChan:
+		errStr := ""
+		if res.code == 0 {
+			log.Debugln("Exit successfully")
+		}
+		if res.error != nil {
+			log.Debugln("Exit with ERROR: ", res.error.Error())
+			errStr = res.error.Error()
+		}
+		return cli.NewExitError(errStr, res.code)
+	}
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright (C) 2017 "IoT.bzh"
+ * Author Sebastien Douheret <sebastien@iot.bzh>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Interactive / GDB-wrapper mode: when invoked as xds-gdb (AppNativeName ==
+ * "gdb") or with --interactive, xds-exec keeps stdin open and forwards it to
+ * the remote process, so that GDB (or any other interactive tool) can be
+ * driven as if it were running locally.
+ */
+
+package main
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/iotbzh/xds-agent/lib/xaapiv1"
+)
+
+// interactive mode flags, added to execFlags
+var (
+	interactiveMode bool
+	gdbServerPort   string
+)
+
+// isInteractiveMode tells whether xds-exec should keep stdin open and
+// forward it to the remote process, either because it was explicitly asked
+// (--interactive) or because it is run through the xds-gdb symlink.
+func isInteractiveMode() bool {
+	return interactiveMode || AppNativeName == "gdb"
+}
+
+// execInMsg is sent on xaapiv1.ExecInEvent to forward a chunk of stdin read
+// locally to the remote running command
+type execInMsg struct {
+	CmdID string `json:"cmdID"`
+	Stdin string `json:"stdin"`
+}
+
+// gdbMiMarkers are the record-type markers of the GDB/MI protocol, see the
+// "GDB/MI Output Syntax" section of the GDB manual.
+var gdbMiMarkers = []byte{'^', '*', '~', '@', '&', '='}
+
+// isGdbOutput returns true when line looks like a GDB prompt or a GDB/MI
+// record, in which case it should never be prefixed with a timestamp as that
+// would break tools (IDEs, ...) parsing the GDB/MI protocol.
+func isGdbOutput(line string) bool {
+	if strings.HasPrefix(line, "(gdb)") {
+		return true
+	}
+	if line == "" {
+		return false
+	}
+	for _, m := range gdbMiMarkers {
+		if line[0] == m {
+			return true
+		}
+	}
+	return false
+}
+
+// setupInteractiveMode puts the local terminal in raw mode (when stdin is a
+// TTY) and starts forwarding every byte read from it to the remote command
+// referenced by cmdID, using the xaapiv1.ExecInEvent Socket.IO event. It
+// returns a function that must be called (typically deferred) to restore the
+// terminal to its previous state.
+func setupInteractiveMode(cmdID *string, mu *sync.Mutex) func() {
+	restore := func() {}
+
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		oldState, err := term.MakeRaw(fd)
+		if err != nil {
+			log.Warnf("Cannot set terminal in raw mode: %v", err)
+		} else {
+			restore = func() {
+				_ = term.Restore(fd, oldState)
+			}
+		}
+	}
+
+	go func() {
+		buf := make([]byte, 1024)
+		// pending buffers stdin read before cmdID is known, so that input
+		// typed/piped right at session start isn't silently dropped; it is
+		// flushed as soon as the remote command ID becomes available.
+		var pending []byte
+		for {
+			n, err := os.Stdin.Read(buf)
+			if n > 0 {
+				pending = append(pending, buf[:n]...)
+			}
+			for len(pending) > 0 {
+				mu.Lock()
+				id := *cmdID
+				mu.Unlock()
+				if id == "" {
+					time.Sleep(50 * time.Millisecond)
+					continue
+				}
+				IOSkClient.Emit(xaapiv1.ExecInEvent, execInMsg{CmdID: id, Stdin: string(pending)})
+				pending = nil
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return restore
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright (C) 2017 "IoT.bzh"
+ * Author Sebastien Douheret <sebastien@iot.bzh>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli"
+)
+
+// newMiscCommand creates the 'misc' sub-command, grouping helper verbs that
+// don't belong to projects/sdks/exec.
+func newMiscCommand() cli.Command {
+	return cli.Command{
+		Name:  "misc",
+		Usage: "miscellaneous commands",
+		Subcommands: []cli.Command{
+			{
+				Name:   "version",
+				Usage:  "print xds-exec and xds-agent/server versions",
+				Action: miscVersionAction,
+			},
+		},
+	}
+}
+
+func miscVersionAction(ctx *cli.Context) error {
+	fmt.Printf("%s version: %s\n", AppName, ctx.App.Version)
+
+	var data []byte
+	if err := HTTPCli.HTTPGet("/version", &data); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	fmt.Printf("XDS Agent/Server version: %s\n", string(data[:]))
+	return nil
+}
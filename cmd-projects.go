@@ -0,0 +1,150 @@
+/*
+ * Copyright (C) 2017 "IoT.bzh"
+ * Author Sebastien Douheret <sebastien@iot.bzh>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/iotbzh/xds-agent/lib/xaapiv1"
+	"github.com/urfave/cli"
+)
+
+// newProjectsCommand creates the 'projects' sub-command, used to list and
+// manage the projects known by the xds-agent/server.
+func newProjectsCommand() cli.Command {
+	var path, label string
+
+	return cli.Command{
+		Name:  "projects",
+		Usage: "manage XDS projects",
+		Subcommands: []cli.Command{
+			{
+				Name:   "ls",
+				Usage:  "list existing projects",
+				Action: projectsLsAction,
+			},
+			{
+				Name:      "add",
+				Usage:     "add a new project",
+				ArgsUsage: "--path <local path> --label <label>",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:        "path",
+						Usage:       "local path of the project to share (mandatory)",
+						Destination: &path,
+					},
+					cli.StringFlag{
+						Name:        "label",
+						Usage:       "label of the new project",
+						Destination: &label,
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					return projectsAddAction(ctx, path, label)
+				},
+			},
+			{
+				Name:      "rm",
+				Usage:     "remove a project",
+				ArgsUsage: "<project ID>",
+				Action:    projectsRmAction,
+			},
+			{
+				Name:      "sync",
+				Usage:     "force a project file synchronization",
+				ArgsUsage: "<project ID>",
+				Action:    projectsSyncAction,
+			},
+		},
+	}
+}
+
+func projectsLsAction(ctx *cli.Context) error {
+	var data []byte
+	if err := HTTPCli.HTTPGet("/projects", &data); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	projects := []xaapiv1.ProjectConfig{}
+	if err := json.Unmarshal(data, &projects); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if len(projects) == 0 {
+		fmt.Println("No project found.")
+		return nil
+	}
+
+	fmt.Println("  ID\t\t\t\t | Label\t\t | Status")
+	for _, p := range projects {
+		fmt.Printf("  %s\t | %s\t | %s\n", p.ID, p.Label, p.Status)
+	}
+	return nil
+}
+
+func projectsAddAction(ctx *cli.Context, path, label string) error {
+	if path == "" {
+		return cli.NewExitError("--path option is mandatory", 1)
+	}
+
+	args := xaapiv1.ProjectConfig{
+		Label:      label,
+		ClientPath: path,
+	}
+	body, err := json.Marshal(args)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	log.Infof("POST /projects %v", string(body))
+	if err := HTTPCli.HTTPPost("/projects", string(body)); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	fmt.Printf("Project %q successfully added.\n", path)
+	return nil
+}
+
+func projectsRmAction(ctx *cli.Context) error {
+	id := ctx.Args().First()
+	if id == "" {
+		return cli.NewExitError("project ID argument is mandatory", 1)
+	}
+
+	if err := HTTPCli.HTTPDelete("/projects/" + id); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	fmt.Printf("Project %q successfully removed.\n", id)
+	return nil
+}
+
+func projectsSyncAction(ctx *cli.Context) error {
+	id := ctx.Args().First()
+	if id == "" {
+		return cli.NewExitError("project ID argument is mandatory", 1)
+	}
+
+	if err := HTTPCli.HTTPPost("/projects/"+id+"/sync", ""); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	fmt.Printf("Synchronization of project %q requested.\n", id)
+	return nil
+}
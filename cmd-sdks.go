@@ -0,0 +1,148 @@
+/*
+ * Copyright (C) 2017 "IoT.bzh"
+ * Author Sebastien Douheret <sebastien@iot.bzh>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/iotbzh/xds-agent/lib/xaapiv1"
+	"github.com/urfave/cli"
+)
+
+// sdkInstallMsg is streamed by the agent on 'event:sdk-install' while a SDK
+// is being downloaded/installed, so progress can be printed to stdout.
+type sdkInstallMsg struct {
+	ID       string `json:"id"`
+	Progress int    `json:"progress"`
+	Msg      string `json:"msg"`
+}
+
+// newSdksCommand creates the 'sdks' sub-command, used to list and manage the
+// cross toolchains (SDKs) installed on the xds-agent/server.
+func newSdksCommand() cli.Command {
+	return cli.Command{
+		Name:  "sdks",
+		Usage: "manage cross toolchains (SDKs)",
+		Subcommands: []cli.Command{
+			{
+				Name:   "ls",
+				Usage:  "list installed cross SDKs",
+				Action: sdksLsAction,
+			},
+			{
+				Name:      "install",
+				Usage:     "download and install a cross SDK",
+				ArgsUsage: "<SDK ID>",
+				Action:    sdksInstallAction,
+			},
+			{
+				Name:      "remove",
+				Usage:     "remove an installed cross SDK",
+				ArgsUsage: "<SDK ID>",
+				Action:    sdksRemoveAction,
+			},
+			{
+				Name:   "abort",
+				Usage:  "abort the cross SDK installation in progress",
+				Action: sdksAbortAction,
+			},
+		},
+	}
+}
+
+func sdksLsAction(ctx *cli.Context) error {
+	var data []byte
+	if err := HTTPCli.HTTPGet("/servers/0/sdks", &data); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	sdks := []xaapiv1.SDK{}
+	if err := json.Unmarshal(data, &sdks); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if len(sdks) == 0 {
+		fmt.Println("No cross SDK installed.")
+		return nil
+	}
+
+	fmt.Println("  ID\t\t\t\t\t | NAME")
+	for _, s := range sdks {
+		fmt.Printf("  %s\t | %s\n", s.ID, s.Name)
+	}
+	return nil
+}
+
+func sdksInstallAction(ctx *cli.Context) error {
+	id := ctx.Args().First()
+	if id == "" {
+		return cli.NewExitError("SDK ID argument is mandatory", 1)
+	}
+
+	doneChan := make(chan error, 1)
+	IOSkClient.On("event:sdk-install", func(ev sdkInstallMsg) {
+		if ev.ID != id {
+			return
+		}
+		fmt.Printf("[%3d%%] %s\n", ev.Progress, ev.Msg)
+		if ev.Progress >= 100 {
+			doneChan <- nil
+		}
+	})
+
+	body, err := json.Marshal(xaapiv1.SDK{ID: id})
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	log.Infof("POST /servers/0/sdks %v", string(body))
+	if err := HTTPCli.HTTPPost("/servers/0/sdks", string(body)); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if err := <-doneChan; err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	fmt.Printf("SDK %q successfully installed.\n", id)
+	return nil
+}
+
+func sdksRemoveAction(ctx *cli.Context) error {
+	id := ctx.Args().First()
+	if id == "" {
+		return cli.NewExitError("SDK ID argument is mandatory", 1)
+	}
+
+	if err := HTTPCli.HTTPDelete("/servers/0/sdks/" + id); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	fmt.Printf("SDK %q successfully removed.\n", id)
+	return nil
+}
+
+func sdksAbortAction(ctx *cli.Context) error {
+	if err := HTTPCli.HTTPPost("/servers/0/sdks/abort", ""); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	fmt.Println("SDK installation aborted.")
+	return nil
+}
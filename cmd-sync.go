@@ -0,0 +1,106 @@
+/*
+ * Copyright (C) 2017 "IoT.bzh"
+ * Author Sebastien Douheret <sebastien@iot.bzh>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Gate 'exec' on the project file-sync status: running a command before the
+ * project is fully synchronized to the agent is a frequent footgun (it
+ * produces confusing build failures), so wait for sync to complete first.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/iotbzh/xds-agent/lib/xaapiv1"
+)
+
+// projectStateChangeMsg is streamed by the agent on
+// 'event:project-state-change' while a project's sync status evolves
+type projectStateChangeMsg struct {
+	Project xaapiv1.ProjectConfig `json:"project"`
+}
+
+// getProject retrieves the up to date definition of project id
+func getProject(id string) (xaapiv1.ProjectConfig, error) {
+	prj := xaapiv1.ProjectConfig{}
+
+	var data []byte
+	if err := HTTPCli.HTTPGet("/projects/"+id, &data); err != nil {
+		return prj, err
+	}
+	err := json.Unmarshal(data, &prj)
+	return prj, err
+}
+
+// waitProjectSync returns at once when project id is Enable and fully
+// synchronized. When it is Syncing, it blocks, with a spinner on stderr,
+// until it becomes Enable and fully synchronized, or until timeout elapses.
+// It fails fast when the project is not found or Disable. Any other status
+// (including Enable but not in sync) is not waited for: a warning is logged
+// and nil is returned.
+func waitProjectSync(id string, timeout time.Duration) error {
+	prj, err := getProject(id)
+	if err != nil {
+		return fmt.Errorf("project %q not found (use: %s projects ls)", id, AppName)
+	}
+
+	if prj.Status == "Disable" {
+		return fmt.Errorf("project %q is disabled (use: %s projects ls)", id, AppName)
+	}
+	if prj.Status == "Enable" && prj.IsInSync {
+		return nil
+	}
+	if prj.Status != "Syncing" {
+		log.Warnf("Project %q has unexpected status %q, executing anyway", id, prj.Status)
+		return nil
+	}
+
+	doneChan := make(chan error, 1)
+	IOSkClient.On("event:project-state-change", func(ev projectStateChangeMsg) {
+		p := ev.Project
+		if p.ID != id {
+			return
+		}
+		if p.Status == "Disable" {
+			doneChan <- fmt.Errorf("project %q got disabled while waiting for sync", id)
+		} else if p.Status == "Enable" && p.IsInSync {
+			doneChan <- nil
+		}
+	})
+
+	spinner := `-\|/`
+	ticker := time.NewTicker(300 * time.Millisecond)
+	defer ticker.Stop()
+	timeoutChan := time.After(timeout)
+
+	i := 0
+	for {
+		select {
+		case err := <-doneChan:
+			fmt.Fprintln(os.Stderr)
+			return err
+		case <-ticker.C:
+			fmt.Fprintf(os.Stderr, "\rWaiting for project %q to be synchronized... %c", id, spinner[i%len(spinner)])
+			i++
+		case <-timeoutChan:
+			fmt.Fprintln(os.Stderr)
+			return fmt.Errorf("timeout (%v) while waiting for project %q to be synchronized", timeout, id)
+		}
+	}
+}
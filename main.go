@@ -21,16 +21,13 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
-
 	"strings"
 
 	"github.com/Sirupsen/logrus"
-	"github.com/iotbzh/xds-agent/lib/xaapiv1"
 	common "github.com/iotbzh/xds-common/golib"
 	"github.com/joho/godotenv"
 	socketio_client "github.com/sebd71/go-socket.io-client"
@@ -65,6 +62,42 @@ const (
 	defaultLogLevel = "error"
 )
 
+// defaultConfigEnvFilename is the name of the env config file that is
+// auto-discovered when --config/-c is not set (see findDefaultConfigFile)
+const defaultConfigEnvFilename = "cli-config.env"
+
+// HTTPCli is the shared HTTP client used by all sub-commands to talk to the
+// xds-agent/server REST API. It is initialized once by app.Before.
+var HTTPCli *common.HTTPClient
+
+// IOSkClient is the shared Socket.IO client used by sub-commands that need to
+// stream events from the xds-agent/server (exec, sdks install...). It is
+// initialized once by app.Before.
+var IOSkClient *socketio_client.Client
+
+// baseURL is the xds-agent/server base url (computed once from the --url flag)
+var baseURL string
+
+// global (persistent) flags values, destination of app.Flags and filled in
+// before app.Before/Action are invoked
+var (
+	gURL      string
+	gConfFile string
+	gLogLevel string
+)
+
+// hostEnv is only used for debug logging
+var hostEnv []string
+
+// envMap holds the variables sourced from the config file (--config option,
+// XDS_CONFIG variable or auto-discovered defaultConfigEnvFilename)
+var envMap map[string]string
+
+// argsCommand is the native command (and its arguments) to execute remotely,
+// IOW everything found after the '--' separator (or the whole argv when
+// invoked through the AppNativeName symlink)
+var argsCommand []string
+
 // exitError exists this program with the specified error
 func exitError(code int, f string, a ...interface{}) {
 	err := fmt.Sprintf(f, a...)
@@ -72,10 +105,63 @@ func exitError(code int, f string, a ...interface{}) {
 	os.Exit(code)
 }
 
+// Exists returns whether the given file or directory exists or not
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	if err == nil {
+		return true
+	}
+	if os.IsNotExist(err) {
+		return false
+	}
+	return true
+}
+
+// defaultConfigSearchDirs returns, in priority order, the directories that
+// are looked up to auto-discover defaultConfigEnvFilename. It can be extended
+// with a colon-separated XDS_CONFIG_PATH environment variable.
+func defaultConfigSearchDirs() []string {
+	dirs := []string{}
+
+	if cwd, err := os.Getwd(); err == nil {
+		dirs = append(dirs, cwd, filepath.Join(cwd, ".xds"))
+	}
+	if xdgHome := os.Getenv("XDG_CONFIG_HOME"); xdgHome != "" {
+		dirs = append(dirs, filepath.Join(xdgHome, "xds"))
+	}
+	if home := os.Getenv("HOME"); home != "" {
+		dirs = append(dirs, filepath.Join(home, ".config", "xds"))
+	}
+	dirs = append(dirs, "/etc/xds")
+
+	if extra := os.Getenv("XDS_CONFIG_PATH"); extra != "" {
+		dirs = append(dirs, strings.Split(extra, ":")...)
+	}
+
+	return dirs
+}
+
+// findDefaultConfigFile searches defaultConfigSearchDirs (in order) for a
+// defaultConfigEnvFilename file. It returns the first match (to be used) along
+// with the full list of matches found (so that a warning can be emitted when
+// more than one candidate exists).
+func findDefaultConfigFile() (string, []string) {
+	candidates := []string{}
+	for _, dir := range defaultConfigSearchDirs() {
+		f := filepath.Join(dir, defaultConfigEnvFilename)
+		if exists(f) {
+			candidates = append(candidates, f)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", nil
+	}
+	return candidates[0], candidates
+}
+
 // main
 func main() {
-	var uri, prjID, rPath, logLevel, sdkid, confFile string
-	var withTimestamp, listProject bool
+	var confFile string
 
 	// Allow to set app name from exec (useful for debugging)
 	if AppName == "" {
@@ -97,6 +183,10 @@ func main() {
      2. else use variable 'XDS_xxx' (for example 'XDS_PROJECT_ID' variable) when a
         config file is specified with '--config|-c' option,
      3. else use 'XDS_xxx' (for example 'XDS_PROJECT_ID') environment variable.
+
+   When '--config|-c' is not set, xds-exec auto-discovers a '` + defaultConfigEnvFilename + `' file in
+   $PWD, $PWD/.xds/, $XDG_CONFIG_HOME/xds/, $HOME/.config/xds/ and /etc/xds/ (in that order),
+   extensible with a colon-separated 'XDS_CONFIG_PATH' environment variable.
 `
 
 	// Create a new App instance
@@ -111,58 +201,42 @@ func main() {
 	app.Metadata["git-tag"] = AppSubVersion
 	app.Metadata["logger"] = log
 
-	app.Flags = []cli.Flag{
-		cli.StringFlag{
-			Name:        "id",
-			EnvVar:      "XDS_PROJECT_ID",
-			Usage:       "project ID you want to build (mandatory variable)",
-			Destination: &prjID,
-		},
+	globalFlags := []cli.Flag{
 		cli.StringFlag{
 			Name:        "config, c",
 			EnvVar:      "XDS_CONFIG",
 			Usage:       "env config file to source on startup",
-			Destination: &confFile,
-		},
-		cli.BoolFlag{
-			Name:        "list, ls",
-			Usage:       "list existing projects",
-			Destination: &listProject,
+			Destination: &gConfFile,
 		},
 		cli.StringFlag{
 			Name:        "log, l",
 			EnvVar:      "XDS_LOGLEVEL",
 			Usage:       "logging level (supported levels: panic, fatal, error, warn, info, debug)",
 			Value:       defaultLogLevel,
-			Destination: &logLevel,
-		},
-		cli.StringFlag{
-			Name:        "rpath",
-			EnvVar:      "XDS_RPATH",
-			Usage:       "relative path into project",
-			Destination: &rPath,
-		},
-		cli.StringFlag{
-			Name:        "sdkid",
-			EnvVar:      "XDS_SDK_ID",
-			Usage:       "Cross Sdk ID to use to build project",
-			Destination: &sdkid,
-		},
-		cli.BoolFlag{
-			Name:        "timestamp, ts",
-			EnvVar:      "XDS_TIMESTAMP",
-			Usage:       "prefix output with timestamp",
-			Destination: &withTimestamp,
+			Destination: &gLogLevel,
 		},
 		cli.StringFlag{
 			Name:        "url",
 			EnvVar:      "XDS_AGENT_URL",
 			Value:       "localhost:8000",
 			Usage:       "local XDS agent url",
-			Destination: &uri,
+			Destination: &gURL,
 		},
 	}
 
+	// Sub-commands, one file per verb
+	app.Commands = []cli.Command{
+		newExecCommand(),
+		newProjectsCommand(),
+		newSdksCommand(),
+		newMiscCommand(),
+	}
+
+	// Legacy top-level flags/action: preserve `xds-exec --id xxx -- <cmd>` (and
+	// the AppNativeName-symlink mode) working without having to type `exec`.
+	app.Flags = append(globalFlags, execFlags...)
+	app.Action = execAction
+
 	// Create env vars help
 	dynDesc := "\nENVIRONMENT VARIABLES:"
 	for _, f := range app.Flags {
@@ -176,6 +250,10 @@ func main() {
 			fb := f.(cli.BoolFlag)
 			env = fb.EnvVar
 			usage = fb.Usage
+		case cli.IntFlag:
+			fi := f.(cli.IntFlag)
+			env = fi.EnvVar
+			usage = fi.Usage
 		default:
 			exitError(1, "Un-implemented option type")
 		}
@@ -187,16 +265,16 @@ func main() {
 
 	args := make([]string, len(os.Args))
 	args[0] = os.Args[0]
-	argsCommand := make([]string, len(os.Args))
+	argsCommand = make([]string, len(os.Args))
 	exeName := filepath.Base(os.Args[0])
 
 	// Just use to debug log
-	hostEnv := os.Environ()
+	hostEnv = os.Environ()
 
 	// Split xds-xxx options from native command (eg. make) options
 	// only process args before skip arguments, IOW before '--'
 	found := false
-	envMap := make(map[string]string)
+	envMap = make(map[string]string)
 	if exeName != AppNativeName {
 		for idx, a := range os.Args[1:] {
 			if a == "-c" || a == "--config" {
@@ -233,34 +311,77 @@ func main() {
 		copy(argsCommand, os.Args)
 	}
 
-	// only one action
-	app.Action = func(ctx *cli.Context) error {
-		var err error
+	// --config/-c was not given on the command line: XDS_CONFIG (the flag's
+	// own EnvVar) still counts as "config given" and must skip auto-discovery
+	if confFile == "" {
+		if envConf := os.Getenv("XDS_CONFIG"); envConf != "" {
+			confFile = envConf
+			if !exists(confFile) {
+				exitError(1, "Error env config file not found")
+			}
+			var err error
+			if err = godotenv.Overload(confFile); err != nil {
+				exitError(1, "Error loading env config file "+confFile)
+			}
+			envMap, err = godotenv.Read(confFile)
+			if err != nil {
+				exitError(1, "Error reading env config file "+confFile)
+			}
+		}
+	}
 
-		var execCommand, ccHelp string
-		switch AppName {
-		case "xds-exec":
-			execCommand = "/exec"
-			ccHelp = "'mkdir build; cd build; cmake ..'"
-		default:
-			panic("Un-implemented command")
+	// When neither --config/-c nor XDS_CONFIG was set, auto-discover a
+	// default config env file
+	if confFile == "" {
+		file, candidates := findDefaultConfigFile()
+		if len(candidates) > 1 {
+			fmt.Fprintf(os.Stderr, "Warning: multiple %s candidates found (%s), using %s\n",
+				defaultConfigEnvFilename, strings.Join(candidates, ", "), file)
 		}
+		if file != "" {
+			confFile = file
+			// Load config file variables without overwriting real env variables
+			if err := godotenv.Load(confFile); err != nil {
+				exitError(1, "Error loading env config file "+confFile)
+			}
+			fileVars, err := godotenv.Read(confFile)
+			if err != nil {
+				exitError(1, "Error reading env config file "+confFile)
+			}
+			// Build envMap from the already-merged process environment (real
+			// env vars win, file values only apply where the host had none)
+			// rather than from the raw file, so the remote command sees the
+			// same precedence as godotenv.Load just applied locally.
+			envMap = make(map[string]string, len(fileVars))
+			for k := range fileVars {
+				if v, ok := os.LookupEnv(k); ok {
+					envMap[k] = v
+				}
+			}
+		}
+	}
+	if confFile != "" {
+		app.Metadata["configFile"] = confFile
+		log.Debugf("Using config file: %s", confFile)
+	}
 
-		// Set logger level and formatter
-		if log.Level, err = logrus.ParseLevel(logLevel); err != nil {
-			msg := fmt.Sprintf("Invalid log level : \"%v\"\n", logLevel)
+	// app.Before connects HTTPCli/IOSkClient, shared by every sub-command
+	app.Before = func(ctx *cli.Context) error {
+		var err error
+
+		if log.Level, err = logrus.ParseLevel(gLogLevel); err != nil {
+			msg := fmt.Sprintf("Invalid log level : \"%v\"\n", gLogLevel)
 			return cli.NewExitError(msg, 1)
 		}
 		log.Formatter = &logrus.TextFormatter{}
 
-		log.Infof("%s version: %s", AppName, app.Version)
+		log.Infof("%s version: %s", AppName, ctx.App.Version)
 		log.Debugf("Environment: %v", hostEnv)
-		log.Infof("Execute: %s %v", execCommand, argsCommand)
 
 		// Define HTTP and WS url
-		baseURL := uri
-		if !strings.HasPrefix(uri, "http://") {
-			baseURL = "http://" + uri
+		baseURL = gURL
+		if !strings.HasPrefix(gURL, "http://") {
+			baseURL = "http://" + gURL
 		}
 
 		// Create HTTP client
@@ -270,7 +391,7 @@ func main() {
 			HeaderClientKeyName: "Xds-Agent-Sid",
 			CsrfDisable:         true,
 		}
-		c, err := common.HTTPNewClient(baseURL, conf)
+		HTTPCli, err = common.HTTPNewClient(baseURL, conf)
 		if err != nil {
 			errmsg := err.Error()
 			if m, err := regexp.MatchString("Get http.?://", errmsg); m && err == nil {
@@ -282,67 +403,11 @@ func main() {
 
 		// First call to check that daemon is alive
 		var data []byte
-		if err := c.HTTPGet("/version", &data); err != nil {
+		if err := HTTPCli.HTTPGet("/version", &data); err != nil {
 			return cli.NewExitError(err.Error(), 1)
 		}
 		log.Infof("XDS Agent/Server version: %v", string(data[:]))
 
-		// Retrieve projects list used by help output
-		if err := c.HTTPGet("/projects", &data); err != nil {
-			return cli.NewExitError(err.Error(), 1)
-		}
-		log.Debugf("Result of /projects: %v", string(data[:]))
-
-		projects := []xaapiv1.ProjectConfig{}
-		errMar := json.Unmarshal(data, &projects)
-
-		// Check mandatory args
-		if prjID == "" || listProject {
-			msg := ""
-			exc := 0
-			if !listProject {
-				msg = "XDS_PROJECT_ID environment variable must be set !\n"
-				exc = 1
-			}
-			if errMar == nil {
-				msg += "List of existing projects (use: export XDS_PROJECT_ID=<< ID >>): \n"
-				msg += "  ID\t\t\t\t | Label"
-				for _, f := range projects {
-					msg += fmt.Sprintf("\n  %s\t | %s", f.ID, f.Label)
-					if f.DefaultSdk != "" {
-						msg += fmt.Sprintf("\t(default SDK: %s)", f.DefaultSdk)
-					}
-				}
-				msg += "\n"
-			}
-
-			data = nil
-			if err := c.HTTPGet("/servers/0/sdks", &data); err != nil {
-				return cli.NewExitError(err.Error(), 1)
-			}
-			log.Debugf("Result of /sdks: %v", string(data[:]))
-
-			sdks := []xaapiv1.SDK{}
-			errMar = json.Unmarshal(data, &sdks)
-			if errMar == nil {
-				msg += "\nList of installed cross SDKs (use: export XDS_SDK_ID=<< ID >>): \n"
-				msg += "  ID\t\t\t\t\t | NAME\n"
-				for _, s := range sdks {
-					msg += fmt.Sprintf("  %s\t | %s\n", s.ID, s.Name)
-				}
-			}
-
-			if len(projects) > 0 && len(sdks) > 0 {
-				msg += fmt.Sprintf("\n")
-				msg += fmt.Sprintf("For example: \n")
-				msg += fmt.Sprintf("  %s --id %q --sdkid %q -- %s\n", AppName, projects[0].ID, sdks[0].ID, ccHelp)
-				msg += " or\n"
-				msg += fmt.Sprintf("  XDS_PROJECT_ID=%q XDS_SDK_ID=%q  %s %s\n", projects[0].ID, sdks[0].ID, AppNativeName, ccHelp)
-			}
-
-			return cli.NewExitError(msg, exc)
-		}
-
 		// Create io Websocket client
 		log.Debugln("Connecting IO.socket client on ", baseURL)
 
@@ -350,130 +415,19 @@ func main() {
 			Transport: "websocket",
 			Header:    make(map[string][]string),
 		}
-		opts.Header["XDS-AGENT-SID"] = []string{c.GetClientID()}
+		opts.Header["XDS-AGENT-SID"] = []string{HTTPCli.GetClientID()}
 
-		iosk, err := socketio_client.NewClient(baseURL, opts)
+		IOSkClient, err = socketio_client.NewClient(baseURL, opts)
 		if err != nil {
 			return cli.NewExitError("IO.socket connection error: "+err.Error(), 1)
 		}
 
-		// Process Socket IO events
-		type exitResult struct {
-			error error
-			code  int
-		}
-		exitChan := make(chan exitResult, 1)
-
-		iosk.On("error", func(err error) {
+		IOSkClient.On("error", func(err error) {
 			fmt.Println("ERROR: ", err.Error())
 		})
 
-		iosk.On("disconnection", func(err error) {
-			exitChan <- exitResult{err, 2}
-		})
-
-		outFunc := func(timestamp, stdout, stderr string) {
-			tm := ""
-			if withTimestamp {
-				tm = timestamp + "| "
-			}
-			if withTimestamp {
-				tm = timestamp + "| "
-			}
-			if stdout != "" {
-				fmt.Printf("%s%s", tm, stdout)
-			}
-			if stderr != "" {
-				fmt.Fprintf(os.Stderr, "%s%s", tm, stderr)
-			}
-		}
-
-		iosk.On(xaapiv1.ExecOutEvent, func(ev xaapiv1.ExecOutMsg) {
-			outFunc(ev.Timestamp, ev.Stdout, ev.Stderr)
-		})
-
-		iosk.On(xaapiv1.ExecExitEvent, func(ev xaapiv1.ExecExitMsg) {
-			exitChan <- exitResult{ev.Error, ev.Code}
-		})
-
-		// Retrieve the projects definition
-		var project *xaapiv1.ProjectConfig
-		for _, f := range projects {
-			if f.ID == prjID {
-				project = &f
-				break
-			}
-		}
-
-		// Auto setup rPath if needed
-		if rPath == "" && project != nil {
-			cwd, err := os.Getwd()
-			if err == nil {
-				fldRp := project.ClientPath
-				if !strings.HasPrefix(fldRp, "/") {
-					fldRp = "/" + fldRp
-				}
-				log.Debugf("Try to auto-setup rPath: cwd=%s ; ClientPath=%s", cwd, fldRp)
-				if sp := strings.SplitAfter(cwd, fldRp); len(sp) == 2 {
-					rPath = strings.Trim(sp[1], "/")
-					log.Debugf("Auto-setup rPath to: '%s'", rPath)
-				}
-			}
-		}
-
-		// Build env
-		log.Debugf("Command env: %v", envMap)
-		env := []string{}
-		for k, v := range envMap {
-			env = append(env, k+"="+v)
-		}
-
-		// Send build command
-		var body []byte
-		args := xaapiv1.ExecArgs{
-			ID:         prjID,
-			SdkID:      sdkid,
-			Cmd:        strings.Trim(argsCommand[0], " "),
-			Args:       argsCommand[1:],
-			Env:        env,
-			RPath:      rPath,
-			CmdTimeout: 60,
-		}
-		body, err = json.Marshal(args)
-		if err != nil {
-			return cli.NewExitError(err.Error(), 1)
-		}
-		log.Infof("POST %s%s %v", uri, execCommand, string(body))
-		if err := c.HTTPPost(execCommand, string(body)); err != nil {
-			return cli.NewExitError(err.Error(), 1)
-		}
-
-		// Wait exit
-		select {
-		case res := <-exitChan:
-			errStr := ""
-			if res.code == 0 {
-				log.Debugln("Exit successfully")
-			}
-			if res.error != nil {
-				log.Debugln("Exit with ERROR: ", res.error.Error())
-				errStr = res.error.Error()
-			}
-			return cli.NewExitError(errStr, res.code)
-		}
+		return nil
 	}
 
 	app.Run(args)
 }
-
-// Exists returns whether the given file or directory exists or not
-func exists(path string) bool {
-	_, err := os.Stat(path)
-	if err == nil {
-		return true
-	}
-	if os.IsNotExist(err) {
-		return false
-	}
-	return true
-}